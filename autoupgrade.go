@@ -0,0 +1,155 @@
+package rdns
+
+import (
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// AutoUpgrade wraps a plain (UDP/TCP) resolver and transparently upgrades
+// queries to DoH when the wrapped resolver's address matches a well-known
+// public DNS provider. The original IP is used as bootstrap address so the
+// upgrade doesn't require an extra lookup. Only DoH is used; a provider's
+// DoTAddress is not read.
+type AutoUpgrade struct {
+	id       string
+	resolver Resolver
+	upgraded Resolver
+	opt      AutoUpgradeOptions
+}
+
+var _ Resolver = &AutoUpgrade{}
+
+// AutoUpgradeOptions contain settings for the auto-upgrade resolver.
+type AutoUpgradeOptions struct {
+	// How long to wait for the upgraded (encrypted) resolver to answer
+	// before also sending the query to the plain fallback. Default 200ms.
+	HeadStart time.Duration
+
+	// Providers overrides/extends the built-in table of well-known public
+	// resolver IPs, keyed by IP. Entries here take precedence over the
+	// built-in defaults for the same key.
+	Providers map[string]AutoUpgradeProvider
+}
+
+// AutoUpgradeProvider describes how to reach a well-known public DNS
+// provider over an encrypted transport. Exported so config loading can
+// extend or override the built-in provider table.
+type AutoUpgradeProvider struct {
+	DoHURL     string
+	DoTAddress string
+	ServerName string
+}
+
+// defaultProviders maps well-known public resolver IPs to their DoH/DoT
+// endpoints. Not exhaustive, but covers the common public resolvers.
+var defaultProviders = map[string]AutoUpgradeProvider{
+	"8.8.8.8":         {DoHURL: "https://dns.google/dns-query", DoTAddress: "8.8.8.8:853", ServerName: "dns.google"},
+	"8.8.4.4":         {DoHURL: "https://dns.google/dns-query", DoTAddress: "8.8.4.4:853", ServerName: "dns.google"},
+	"1.1.1.1":         {DoHURL: "https://cloudflare-dns.com/dns-query", DoTAddress: "1.1.1.1:853", ServerName: "cloudflare-dns.com"},
+	"1.0.0.1":         {DoHURL: "https://cloudflare-dns.com/dns-query", DoTAddress: "1.0.0.1:853", ServerName: "cloudflare-dns.com"},
+	"9.9.9.9":         {DoHURL: "https://dns.quad9.net/dns-query", DoTAddress: "9.9.9.9:853", ServerName: "dns.quad9.net"},
+	"149.112.112.112": {DoHURL: "https://dns.quad9.net/dns-query", DoTAddress: "149.112.112.112:853", ServerName: "dns.quad9.net"},
+	"208.67.222.222":  {DoHURL: "https://doh.opendns.com/dns-query", DoTAddress: "208.67.222.222:853", ServerName: "dns.opendns.com"},
+	"208.67.220.220":  {DoHURL: "https://doh.opendns.com/dns-query", DoTAddress: "208.67.220.220:853", ServerName: "dns.opendns.com"},
+}
+
+// providerFor looks up host in opt.Providers first, falling back to the
+// built-in defaultProviders table.
+func providerFor(host string, opt AutoUpgradeOptions) (AutoUpgradeProvider, bool) {
+	if p, ok := opt.Providers[host]; ok {
+		return p, true
+	}
+	p, ok := defaultProviders[host]
+	return p, ok
+}
+
+// NewAutoUpgrade returns a resolver that wraps a plain resolver and, if its
+// address matches a known public DNS provider, upgrades queries to DoH
+// transparently. If the address isn't recognized, it simply passes queries
+// through to the wrapped resolver unchanged. dialOpt carries the LocalAddr,
+// Dialer (e.g. SOCKS5) and QueryTimeout the plain resolver was configured
+// with, so the upgraded transport shares them rather than going out in the
+// clear, unproxied, or without a timeout.
+func NewAutoUpgrade(id string, resolver Resolver, address string, dialOpt DNSClientOptions, opt AutoUpgradeOptions) (*AutoUpgrade, error) {
+	if opt.HeadStart == 0 {
+		opt.HeadStart = 200 * time.Millisecond
+	}
+	a := &AutoUpgrade{id: id, resolver: resolver, opt: opt}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	provider, ok := providerFor(host, opt)
+	if !ok {
+		return a, nil
+	}
+
+	tlsConfig, err := TLSClientConfig("", "", "", provider.ServerName)
+	if err != nil {
+		return nil, err
+	}
+	dohOpt := DoHClientOptions{
+		TLSConfig:     tlsConfig,
+		BootstrapAddr: host,
+		LocalAddr:     dialOpt.LocalAddr,
+		Dialer:        dialOpt.Dialer,
+		QueryTimeout:  dialOpt.QueryTimeout,
+	}
+	upgraded, err := NewDoHClient(id+"-auto-upgrade", provider.DoHURL, dohOpt)
+	if err != nil {
+		return nil, err
+	}
+	a.upgraded = upgraded
+	return a, nil
+}
+
+// Resolve races the upgraded (encrypted) resolver against the plain
+// resolver, giving the encrypted transport a head-start. If no upgrade is
+// available, the query goes straight to the wrapped plain resolver.
+func (r *AutoUpgrade) Resolve(q *dns.Msg, ci ClientInfo) (*dns.Msg, error) {
+	if r.upgraded == nil {
+		return r.resolver.Resolve(q, ci)
+	}
+
+	type result struct {
+		a   *dns.Msg
+		err error
+	}
+	upgradedCh := make(chan result, 1)
+	go func() {
+		a, err := r.upgraded.Resolve(q, ci)
+		upgradedCh <- result{a, err}
+	}()
+
+	select {
+	case res := <-upgradedCh:
+		if res.err == nil {
+			return res.a, nil
+		}
+	case <-time.After(r.opt.HeadStart):
+	}
+
+	plainCh := make(chan result, 1)
+	go func() {
+		a, err := r.resolver.Resolve(q, ci)
+		plainCh <- result{a, err}
+	}()
+
+	select {
+	case res := <-upgradedCh:
+		if res.err == nil {
+			return res.a, nil
+		}
+		res = <-plainCh
+		return res.a, res.err
+	case res := <-plainCh:
+		return res.a, res.err
+	}
+}
+
+func (r *AutoUpgrade) String() string {
+	return r.id
+}
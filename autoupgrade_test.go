@@ -0,0 +1,28 @@
+package rdns
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProviderFor(t *testing.T) {
+	p, ok := providerFor("1.1.1.1", AutoUpgradeOptions{})
+	require.True(t, ok)
+	require.Equal(t, "cloudflare-dns.com", p.ServerName)
+
+	_, ok = providerFor("192.0.2.1", AutoUpgradeOptions{})
+	require.False(t, ok)
+
+	opt := AutoUpgradeOptions{Providers: map[string]AutoUpgradeProvider{
+		"192.0.2.1": {DoHURL: "https://example.com/dns-query", ServerName: "example.com"},
+		"1.1.1.1":   {DoHURL: "https://override.example/dns-query", ServerName: "override.example"},
+	}}
+	p, ok = providerFor("192.0.2.1", opt)
+	require.True(t, ok)
+	require.Equal(t, "example.com", p.ServerName)
+
+	p, ok = providerFor("1.1.1.1", opt)
+	require.True(t, ok)
+	require.Equal(t, "override.example", p.ServerName, "configured override should take precedence over built-in default")
+}
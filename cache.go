@@ -0,0 +1,210 @@
+package rdns
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Cache is a resolver that caches answers from an upstream resolver,
+// including negative (NXDOMAIN/NODATA) and SERVFAIL responses, to shield
+// upstreams from repeated queries and transient flakiness.
+type Cache struct {
+	id       string
+	resolver Resolver
+	opt      CacheOptions
+	mu       sync.Mutex
+	entries  map[string]cacheEntry
+}
+
+var _ Resolver = &Cache{}
+
+// CacheOptions contain settings for the cache resolver.
+type CacheOptions struct {
+	// Capacity of the cache, default 4096. Once full, an expired entry is
+	// evicted if one can be found, otherwise an arbitrary live one is -
+	// there's no separate sweep goroutine, so eviction only happens as a
+	// side effect of inserting a new entry.
+	Capacity int
+
+	// How long SERVFAIL responses are cached for, default 5 seconds, as
+	// recommended by RFC 8767 section 4 to avoid amplifying an upstream's
+	// transient failures while still shielding it from a retry storm.
+	ServfailTTL time.Duration
+
+	// Upper bound on how long NXDOMAIN/NODATA responses are cached for,
+	// clamping the SOA MINIMUM field per RFC 2308. Default 1 hour.
+	NegativeTTL time.Duration
+}
+
+type cacheEntry struct {
+	answer  *dns.Msg
+	expires time.Time
+}
+
+// NewCache returns a new instance of a cache resolver.
+func NewCache(id string, resolver Resolver, opt CacheOptions) *Cache {
+	if opt.Capacity == 0 {
+		opt.Capacity = 4096
+	}
+	if opt.ServfailTTL == 0 {
+		opt.ServfailTTL = 5 * time.Second
+	}
+	if opt.NegativeTTL == 0 {
+		opt.NegativeTTL = time.Hour
+	}
+	return &Cache{
+		id:       id,
+		resolver: resolver,
+		opt:      opt,
+		entries:  make(map[string]cacheEntry),
+	}
+}
+
+// Resolve answers from cache if possible, otherwise forwards the query
+// upstream and caches the answer according to its type and TTL.
+func (c *Cache) Resolve(q *dns.Msg, ci ClientInfo) (*dns.Msg, error) {
+	key := cacheKey(q)
+	if key != "" {
+		if a, remaining, ok := c.get(key); ok {
+			a = a.Copy()
+			a.Id = q.Id
+			ageAnswer(a, remaining)
+			return a, nil
+		}
+	}
+
+	a, err := c.resolver.Resolve(q, ci)
+	if err != nil || a == nil || key == "" {
+		return a, err
+	}
+	if ttl, ok := cacheTTL(q, a, c.opt); ok {
+		c.set(key, a, ttl)
+	}
+	return a, nil
+}
+
+// get returns the cached answer for key along with how many seconds remain
+// until it expires, so the caller can age the record's TTLs down before
+// returning it to the client.
+func (c *Cache) get(key string) (*dns.Msg, uint32, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, 0, false
+	}
+	remaining := entry.expires.Sub(time.Now())
+	if remaining <= 0 {
+		delete(c.entries, key)
+		return nil, 0, false
+	}
+	return entry.answer, uint32(remaining.Round(time.Second) / time.Second), true
+}
+
+// ageAnswer clamps every record's TTL in the answer to remaining, so a
+// response served from cache reflects how much longer it's actually valid
+// for rather than the TTL it had when it was first cached.
+func ageAnswer(a *dns.Msg, remaining uint32) {
+	for _, section := range [][]dns.RR{a.Answer, a.Ns, a.Extra} {
+		for _, rr := range section {
+			if rr.Header().Ttl > remaining {
+				rr.Header().Ttl = remaining
+			}
+		}
+	}
+}
+
+func (c *Cache) set(key string, a *dns.Msg, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= c.opt.Capacity {
+		c.evictLocked()
+	}
+	c.entries[key] = cacheEntry{answer: a.Copy(), expires: time.Now().Add(ttl)}
+}
+
+// evictLocked removes one entry to make room for a new one, preferring an
+// already-expired entry over an arbitrary live one so the cache stays
+// self-cleaning under its default (capacity-bounded) configuration without
+// needing a separate sweep goroutine. Caller must hold c.mu.
+func (c *Cache) evictLocked() {
+	now := time.Now()
+	for k, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, k)
+			return
+		}
+	}
+	for k := range c.entries {
+		delete(c.entries, k)
+		return
+	}
+}
+
+func (c *Cache) String() string {
+	return c.id
+}
+
+// cacheKey returns a key to cache the answer to q under, or "" if the query
+// should never be cached (e.g. ACME challenge lookups, which change
+// frequently and must not be served stale or issuance breaks).
+func cacheKey(q *dns.Msg) string {
+	if len(q.Question) != 1 {
+		return ""
+	}
+	question := q.Question[0]
+	name := strings.ToLower(question.Name)
+	if question.Qtype == dns.TypeTXT && strings.HasPrefix(name, "_acme-challenge.") {
+		return ""
+	}
+	return name + "/" + dns.TypeToString[question.Qtype] + "/" + dns.ClassToString[question.Qclass]
+}
+
+// cacheTTL determines the TTL to cache the answer a for, clamping SERVFAIL
+// responses to ServfailTTL (RFC 8767 section 4) and negative responses
+// (NXDOMAIN/NODATA) to the SOA MINIMUM field capped by NegativeTTL (RFC
+// 2308). Returns ok=false if the response shouldn't be cached at all.
+func cacheTTL(q *dns.Msg, a *dns.Msg, opt CacheOptions) (time.Duration, bool) {
+	switch a.Rcode {
+	case dns.RcodeServerFailure:
+		return opt.ServfailTTL, true
+	case dns.RcodeSuccess:
+		if len(a.Answer) > 0 {
+			return time.Duration(minTTL(a.Answer)) * time.Second, true
+		}
+		// NODATA: success but no answer records, treat like a negative response.
+		return negativeTTL(a, opt), true
+	case dns.RcodeNameError:
+		return negativeTTL(a, opt), true
+	default:
+		return 0, false
+	}
+}
+
+// negativeTTL returns the TTL for a negative response, taken from the SOA
+// MINIMUM field in the authority section and capped by NegativeTTL.
+func negativeTTL(a *dns.Msg, opt CacheOptions) time.Duration {
+	ttl := opt.NegativeTTL
+	for _, rr := range a.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			if soaTTL := time.Duration(soa.Minimum) * time.Second; soaTTL < ttl {
+				ttl = soaTTL
+			}
+			break
+		}
+	}
+	return ttl
+}
+
+func minTTL(rrs []dns.RR) uint32 {
+	min := rrs[0].Header().Ttl
+	for _, rr := range rrs[1:] {
+		if rr.Header().Ttl < min {
+			min = rr.Header().Ttl
+		}
+	}
+	return min
+}
@@ -0,0 +1,73 @@
+package rdns
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheKey(t *testing.T) {
+	acme := new(dns.Msg)
+	acme.SetQuestion("_acme-challenge.example.com.", dns.TypeTXT)
+	require.Equal(t, "", cacheKey(acme), "ACME challenge TXT queries must never be cached")
+
+	other := new(dns.Msg)
+	other.SetQuestion("EXAMPLE.com.", dns.TypeA)
+	require.NotEqual(t, "", cacheKey(other))
+	lower := new(dns.Msg)
+	lower.SetQuestion("example.com.", dns.TypeA)
+	require.Equal(t, cacheKey(lower), cacheKey(other), "key must be case-insensitive and stable")
+}
+
+func TestCacheTTL(t *testing.T) {
+	opt := CacheOptions{ServfailTTL: 5 * time.Second, NegativeTTL: time.Hour}
+	q := new(dns.Msg)
+	q.SetQuestion("example.com.", dns.TypeA)
+
+	servfail := new(dns.Msg)
+	servfail.SetRcode(q, dns.RcodeServerFailure)
+	ttl, ok := cacheTTL(q, servfail, opt)
+	require.True(t, ok)
+	require.Equal(t, opt.ServfailTTL, ttl)
+
+	nxdomain := new(dns.Msg)
+	nxdomain.SetRcode(q, dns.RcodeNameError)
+	nxdomain.Ns = []dns.RR{&dns.SOA{Minimum: 30}}
+	ttl, ok = cacheTTL(q, nxdomain, opt)
+	require.True(t, ok)
+	require.Equal(t, 30*time.Second, ttl, "SOA MINIMUM should be used when it's lower than NegativeTTL")
+
+	refused := new(dns.Msg)
+	refused.SetRcode(q, dns.RcodeRefused)
+	_, ok = cacheTTL(q, refused, opt)
+	require.False(t, ok, "REFUSED should not be cached")
+}
+
+func TestAgeAnswer(t *testing.T) {
+	a := new(dns.Msg)
+	a.Answer = []dns.RR{&dns.A{Hdr: dns.RR_Header{Ttl: 300}}}
+	ageAnswer(a, 10)
+	require.EqualValues(t, 10, a.Answer[0].Header().Ttl)
+
+	a.Answer[0].Header().Ttl = 5
+	ageAnswer(a, 10)
+	require.EqualValues(t, 5, a.Answer[0].Header().Ttl, "should never raise a TTL, only clamp it down")
+}
+
+func TestCacheDefaultCapacityBounded(t *testing.T) {
+	c := NewCache("test", constResolver{rcode: dns.RcodeSuccess}, CacheOptions{})
+	require.Equal(t, 4096, c.opt.Capacity, "cache must have a bounded default capacity, not \"unlimited\"")
+}
+
+func TestCacheEvictsExpiredFirst(t *testing.T) {
+	c := NewCache("test", constResolver{rcode: dns.RcodeSuccess}, CacheOptions{Capacity: 1})
+	c.entries["stale"] = cacheEntry{answer: new(dns.Msg), expires: time.Now().Add(-time.Second)}
+	c.set("fresh", new(dns.Msg), time.Minute)
+
+	_, ok := c.entries["stale"]
+	require.False(t, ok, "expired entry should be evicted before a live one")
+	_, ok = c.entries["fresh"]
+	require.True(t, ok)
+}
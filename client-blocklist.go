@@ -0,0 +1,44 @@
+package rdns
+
+import (
+	"path/filepath"
+
+	"github.com/miekg/dns"
+)
+
+// ClientBlocklist answers queries from matching clients with blocked's
+// response instead of forwarding them to resolver. Clients are matched by
+// glob pattern against ClientInfo.ClientName (see ClientNamesResolver),
+// letting rules target devices by their resolved hostname, e.g. "*.iot.lan".
+type ClientBlocklist struct {
+	id       string
+	resolver Resolver
+	blocked  Resolver
+	names    []string
+}
+
+var _ Resolver = &ClientBlocklist{}
+
+// NewClientBlocklist returns a new instance of ClientBlocklist. names holds
+// glob patterns matched against ClientInfo.ClientName; a client with no
+// resolved name never matches.
+func NewClientBlocklist(id string, resolver, blocked Resolver, names []string) *ClientBlocklist {
+	return &ClientBlocklist{id: id, resolver: resolver, blocked: blocked, names: names}
+}
+
+// Resolve forwards the query to blocked if the client's name matches one of
+// the configured patterns, otherwise passes it on to resolver unchanged.
+func (r *ClientBlocklist) Resolve(q *dns.Msg, ci ClientInfo) (*dns.Msg, error) {
+	if ci.ClientName != "" {
+		for _, pattern := range r.names {
+			if ok, _ := filepath.Match(pattern, ci.ClientName); ok {
+				return r.blocked.Resolve(q, ci)
+			}
+		}
+	}
+	return r.resolver.Resolve(q, ci)
+}
+
+func (r *ClientBlocklist) String() string {
+	return r.id
+}
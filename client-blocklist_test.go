@@ -0,0 +1,45 @@
+package rdns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientBlocklistNames(t *testing.T) {
+	resolver := constResolver{rcode: dns.RcodeSuccess}
+	blocked := constResolver{rcode: dns.RcodeNameError}
+	bl := NewClientBlocklist("test", resolver, blocked, []string{"*.iot.lan", "printer.lan"})
+
+	q := new(dns.Msg)
+	q.SetQuestion("example.com.", dns.TypeA)
+
+	a, err := bl.Resolve(q, ClientInfo{ClientName: "bulb1.iot.lan"})
+	require.NoError(t, err)
+	require.Equal(t, dns.RcodeNameError, a.Rcode, "glob match should be blocked")
+
+	a, err = bl.Resolve(q, ClientInfo{ClientName: "printer.lan"})
+	require.NoError(t, err)
+	require.Equal(t, dns.RcodeNameError, a.Rcode, "exact match should be blocked")
+
+	a, err = bl.Resolve(q, ClientInfo{ClientName: "laptop.lan"})
+	require.NoError(t, err)
+	require.Equal(t, dns.RcodeSuccess, a.Rcode, "non-matching name should pass through")
+
+	a, err = bl.Resolve(q, ClientInfo{})
+	require.NoError(t, err)
+	require.Equal(t, dns.RcodeSuccess, a.Rcode, "unresolved (empty) client name should never match")
+}
+
+type constResolver struct {
+	rcode int
+}
+
+func (r constResolver) Resolve(q *dns.Msg, ci ClientInfo) (*dns.Msg, error) {
+	a := new(dns.Msg)
+	a.SetRcode(q, r.rcode)
+	return a, nil
+}
+
+func (r constResolver) String() string { return "const" }
@@ -0,0 +1,156 @@
+package rdns
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+// ClientNamesResolver wraps a resolver and, for queries coming from a source
+// IP within one of the configured CIDRs, resolves a PTR record for that IP
+// against an upstream resolver and attaches the result to ClientInfo.ClientName so
+// downstream loggers, blocklists and routers can key on it.
+type ClientNamesResolver struct {
+	id       string
+	resolver Resolver
+	upstream Resolver
+	opt      ClientNamesResolverOptions
+	cache    *lru.Cache[string, clientNameEntry]
+
+	mu       sync.Mutex
+	inFlight map[string]bool
+}
+
+var _ Resolver = &ClientNamesResolver{}
+
+// ClientNamesResolverOptions contain settings for the client-name resolver.
+type ClientNamesResolverOptions struct {
+	// CIDRs for which PTR resolution is performed. Queries from source IPs
+	// outside of these ranges are passed through without a lookup, so public
+	// listeners don't leak reverse-lookup queries for their clients.
+	CIDRs []*net.IPNet
+
+	// Size of the client-name cache, default 1024.
+	CacheSize int
+
+	// How long a negative (failed) PTR lookup is cached for before being
+	// retried, default 1 minute.
+	NegativeTTL time.Duration
+
+	// How long a resolved name is cached for, default 1 hour.
+	TTL time.Duration
+}
+
+type clientNameEntry struct {
+	name    string
+	expires time.Time
+}
+
+// NewClientNamesResolver returns a new instance of ClientNamesResolver.
+func NewClientNamesResolver(id string, resolver, upstream Resolver, opt ClientNamesResolverOptions) (*ClientNamesResolver, error) {
+	if opt.CacheSize == 0 {
+		opt.CacheSize = 1024
+	}
+	if opt.TTL == 0 {
+		opt.TTL = time.Hour
+	}
+	if opt.NegativeTTL == 0 {
+		opt.NegativeTTL = time.Minute
+	}
+	cache, err := lru.New[string, clientNameEntry](opt.CacheSize)
+	if err != nil {
+		return nil, err
+	}
+	return &ClientNamesResolver{
+		id:       id,
+		resolver: resolver,
+		upstream: upstream,
+		opt:      opt,
+		cache:    cache,
+		inFlight: make(map[string]bool),
+	}, nil
+}
+
+// Resolve attaches the cached client hostname, if any, to ClientInfo before
+// passing the query on to the wrapped resolver. The PTR lookup itself is
+// asynchronous: a cache miss or expired entry kicks off a background
+// refresh and the current query proceeds immediately rather than blocking on
+// the upstream PTR round trip - without a name on a miss, with the previous
+// (expired) name otherwise. Subsequent queries from the same client pick up
+// the refreshed name once it lands.
+func (r *ClientNamesResolver) Resolve(q *dns.Msg, ci ClientInfo) (*dns.Msg, error) {
+	if ci.SourceIP != nil && r.inScope(ci.SourceIP) {
+		ci.ClientName = r.lookupCached(ci.SourceIP)
+	}
+	return r.resolver.Resolve(q, ci)
+}
+
+func (r *ClientNamesResolver) inScope(ip net.IP) bool {
+	if len(r.opt.CIDRs) == 0 {
+		return true
+	}
+	for _, n := range r.opt.CIDRs {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupCached returns whatever name is currently cached for ip (possibly
+// "" if none is known yet) and, if the entry is missing or expired, starts
+// a background refresh unless one is already in flight for this IP.
+func (r *ClientNamesResolver) lookupCached(ip net.IP) string {
+	key := ip.String()
+	entry, ok := r.cache.Get(key)
+	if ok && time.Now().Before(entry.expires) {
+		return entry.name
+	}
+
+	r.mu.Lock()
+	alreadyRefreshing := r.inFlight[key]
+	if !alreadyRefreshing {
+		r.inFlight[key] = true
+	}
+	r.mu.Unlock()
+
+	if !alreadyRefreshing {
+		go r.refresh(key, ip)
+	}
+	return entry.name
+}
+
+// refresh performs the PTR lookup against the configured upstream resolver
+// and populates the cache with the result (or a negative entry on failure).
+func (r *ClientNamesResolver) refresh(key string, ip net.IP) {
+	defer func() {
+		r.mu.Lock()
+		delete(r.inFlight, key)
+		r.mu.Unlock()
+	}()
+
+	name, ttl := "", r.opt.NegativeTTL
+	arpa, err := dns.ReverseAddr(key)
+	if err == nil {
+		q := new(dns.Msg)
+		q.SetQuestion(arpa, dns.TypePTR)
+		a, err := r.upstream.Resolve(q, ClientInfo{})
+		if err == nil && a != nil {
+			for _, rr := range a.Answer {
+				if ptr, ok := rr.(*dns.PTR); ok {
+					name = ptr.Ptr
+					ttl = r.opt.TTL
+					break
+				}
+			}
+		}
+	}
+	r.cache.Add(key, clientNameEntry{name: name, expires: time.Now().Add(ttl)})
+}
+
+func (r *ClientNamesResolver) String() string {
+	return r.id
+}
@@ -0,0 +1,20 @@
+package rdns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientNamesResolverInScope(t *testing.T) {
+	r := &ClientNamesResolver{}
+	require.True(t, r.inScope(net.ParseIP("203.0.113.1")), "no CIDRs configured means everything is in scope")
+
+	_, cidr, err := net.ParseCIDR("192.168.0.0/16")
+	require.NoError(t, err)
+	r.opt.CIDRs = []*net.IPNet{cidr}
+
+	require.True(t, r.inScope(net.ParseIP("192.168.1.1")))
+	require.False(t, r.inScope(net.ParseIP("203.0.113.1")))
+}
@@ -26,6 +26,7 @@ func instantiateResolver(id string, r resolver, resolvers map[string]rdns.Resolv
 			LocalAddr:     net.ParseIP(r.LocalAddr),
 			TLSConfig:     tlsConfig,
 			QueryTimeout:  time.Duration(r.QueryTimeout) * time.Second,
+			Dialer:        socks5DialerFromConfig(r),
 		}
 		resolvers[id], err = rdns.NewDoQClient(id, r.Address, opt)
 		if err != nil {
@@ -62,6 +63,7 @@ func instantiateResolver(id string, r resolver, resolvers map[string]rdns.Resolv
 			DTLSConfig:    dtlsConfig,
 			UDPSize:       r.EDNS0UDPSize,
 			QueryTimeout:  time.Duration(r.QueryTimeout) * time.Second,
+			Dialer:        socks5DialerFromConfig(r),
 		}
 		resolvers[id], err = rdns.NewDTLSClient(id, r.Address, opt)
 		if err != nil {
@@ -81,6 +83,7 @@ func instantiateResolver(id string, r resolver, resolvers map[string]rdns.Resolv
 			Transport:     r.Transport,
 			LocalAddr:     net.ParseIP(r.LocalAddr),
 			QueryTimeout:  time.Duration(r.QueryTimeout) * time.Second,
+			Dialer:        socks5DialerFromConfig(r),
 		}
 		resolvers[id], err = rdns.NewDoHClient(id, r.Address, opt)
 		if err != nil {
@@ -90,22 +93,131 @@ func instantiateResolver(id string, r resolver, resolvers map[string]rdns.Resolv
 		r.Address = rdns.AddressWithDefault(r.Address, rdns.PlainDNSPort)
 
 		opt := rdns.DNSClientOptions{
-			LocalAddr:    net.ParseIP(r.LocalAddr),
-			UDPSize:      r.EDNS0UDPSize,
-			QueryTimeout: time.Duration(r.QueryTimeout) * time.Second,
-			Dialer:       socks5DialerFromConfig(r),
+			LocalAddr:          net.ParseIP(r.LocalAddr),
+			UDPSize:            r.EDNS0UDPSize,
+			QueryTimeout:       time.Duration(r.QueryTimeout) * time.Second,
+			Dialer:             socks5DialerFromConfig(r),
+			DisableTCPFallback: r.NoTCPFallback,
 		}
 		resolvers[id], err = rdns.NewDNSClient(id, r.Address, r.Protocol, opt)
 		if err != nil {
 			return err
 		}
+		if r.AutoUpgrade {
+			upgradeOpt := rdns.AutoUpgradeOptions{
+				HeadStart: time.Duration(r.AutoUpgradeHeadStart) * time.Millisecond,
+			}
+			resolvers[id], err = rdns.NewAutoUpgrade(id, resolvers[id], r.Address, opt, upgradeOpt)
+			if err != nil {
+				return err
+			}
+		}
 	default:
 		return fmt.Errorf("unsupported protocol '%s' for resolver '%s'", r.Protocol, id)
 	}
 	return nil
 }
 
-// Returns a dialer if a socks5 proxy is configured, nil otherwise
+// Instantiates an rdns.ParallelBest group from a group config
+func instantiateParallelBestGroup(id string, g group, resolvers map[string]rdns.Resolver) error {
+	var gr []rdns.Resolver
+	for _, rname := range g.Resolvers {
+		resolver, ok := resolvers[rname]
+		if !ok {
+			return fmt.Errorf("resolver '%s' not found", rname)
+		}
+		gr = append(gr, resolver)
+	}
+	opt := rdns.ParallelBestOptions{
+		Weights:      g.Weights,
+		MinResponses: g.MinResponses,
+	}
+	resolvers[id] = rdns.NewParallelBest(id, gr, opt)
+	return nil
+}
+
+// Instantiates an rdns.Cache group from a group config
+func instantiateCacheGroup(id string, g group, resolvers map[string]rdns.Resolver) error {
+	if len(g.Resolvers) != 1 {
+		return fmt.Errorf("cache group '%s' needs exactly one resolver", id)
+	}
+	resolver, ok := resolvers[g.Resolvers[0]]
+	if !ok {
+		return fmt.Errorf("resolver '%s' not found", g.Resolvers[0])
+	}
+	opt := rdns.CacheOptions{
+		Capacity:    g.CacheSize,
+		ServfailTTL: time.Duration(g.ServfailTTL) * time.Second,
+		NegativeTTL: time.Duration(g.NegativeTTL) * time.Second,
+	}
+	resolvers[id] = rdns.NewCache(id, resolver, opt)
+	return nil
+}
+
+// Instantiates an rdns.ClientNamesResolver group from a group config. The
+// group's single resolver (g.Resolvers[0]) is the one queries are forwarded
+// to; g.PTRUpstream names a separate resolver used only for the PTR lookups
+// themselves, so reverse-DNS traffic can be routed differently (or to a
+// resolver that already knows the local network, e.g. a router) than the
+// client's actual queries.
+func instantiateClientNamesGroup(id string, g group, resolvers map[string]rdns.Resolver) error {
+	if len(g.Resolvers) != 1 {
+		return fmt.Errorf("client-names group '%s' needs exactly one resolver", id)
+	}
+	resolver, ok := resolvers[g.Resolvers[0]]
+	if !ok {
+		return fmt.Errorf("resolver '%s' not found", g.Resolvers[0])
+	}
+	upstream, ok := resolvers[g.PTRUpstream]
+	if !ok {
+		return fmt.Errorf("resolver '%s' not found", g.PTRUpstream)
+	}
+	var cidrs []*net.IPNet
+	for _, s := range g.CIDRs {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return fmt.Errorf("invalid CIDR '%s' in client-names group '%s': %w", s, id, err)
+		}
+		cidrs = append(cidrs, n)
+	}
+	opt := rdns.ClientNamesResolverOptions{
+		CIDRs:       cidrs,
+		CacheSize:   g.CacheSize,
+		NegativeTTL: time.Duration(g.NegativeTTL) * time.Second,
+	}
+	cn, err := rdns.NewClientNamesResolver(id, resolver, upstream, opt)
+	if err != nil {
+		return err
+	}
+	resolvers[id] = cn
+	return nil
+}
+
+// Instantiates an rdns.ClientBlocklist group from a group config. Queries
+// from a client whose name (see instantiateClientNamesGroup) matches one of
+// g.ClientNames are answered by g.BlockedResolver instead of the group's
+// resolver.
+func instantiateClientBlocklistGroup(id string, g group, resolvers map[string]rdns.Resolver) error {
+	if len(g.Resolvers) != 1 {
+		return fmt.Errorf("client-blocklist group '%s' needs exactly one resolver", id)
+	}
+	resolver, ok := resolvers[g.Resolvers[0]]
+	if !ok {
+		return fmt.Errorf("resolver '%s' not found", g.Resolvers[0])
+	}
+	blocked, ok := resolvers[g.BlockedResolver]
+	if !ok {
+		return fmt.Errorf("resolver '%s' not found", g.BlockedResolver)
+	}
+	resolvers[id] = rdns.NewClientBlocklist(id, resolver, blocked, g.ClientNames)
+	return nil
+}
+
+// Returns a dialer if a socks5 proxy is configured, nil otherwise. Used for
+// all resolver protocols (plain, DoT, DoH, DoQ, DTLS) so a configured SOCKS5
+// proxy applies uniformly regardless of transport. Note that DoQ and DTLS
+// need UDP-associate support in the proxy; creating the client returns an
+// error if that isn't available.
 func socks5DialerFromConfig(cfg resolver) *socks5.Client {
 	if cfg.Socks5Address == "" {
 		return nil
@@ -0,0 +1,55 @@
+package rdns
+
+import (
+	"fmt"
+	"net"
+)
+
+// Dialer is a minimal dialing interface satisfied by both *net.Dialer and
+// proxy clients such as *socks5.Client (github.com/txthinking/socks5). It
+// lets a single configured dialer - including a SOCKS5 proxy - be shared
+// across all resolver transports instead of being tied to the concrete
+// *net.Dialer type.
+type Dialer interface {
+	Dial(network, address string) (net.Conn, error)
+}
+
+// dialUDPPacketConn returns a net.PacketConn for address, for use by
+// UDP-based protocols such as DoQ and DTLS. If dialer is nil, a plain UDP
+// socket is used. If dialer is set, it must support UDP-associate (dialing
+// "udp"); the returned connection is wrapped to satisfy net.PacketConn since
+// a proxied UDP session is represented as a single ReadWriteCloser. An error
+// is returned (rather than silently falling back to a direct connection) if
+// the proxy doesn't support UDP-associate, so callers don't end up leaking
+// queries outside the configured proxy.
+func dialUDPPacketConn(dialer Dialer, localAddr net.IP, address string) (net.PacketConn, net.Addr, error) {
+	raddr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, nil, err
+	}
+	if dialer == nil {
+		pc, err := net.ListenUDP("udp", &net.UDPAddr{IP: localAddr})
+		return pc, raddr, err
+	}
+	conn, err := dialer.Dial("udp", address)
+	if err != nil {
+		return nil, nil, fmt.Errorf("udp-associate via proxy failed, proxy may not support UDP: %w", err)
+	}
+	return &connPacketConn{Conn: conn, raddr: conn.RemoteAddr()}, raddr, nil
+}
+
+// connPacketConn adapts a connected net.Conn (e.g. a SOCKS5 UDP-associate
+// session) to the net.PacketConn interface expected by QUIC/DTLS.
+type connPacketConn struct {
+	net.Conn
+	raddr net.Addr
+}
+
+func (c *connPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	n, err := c.Read(p)
+	return n, c.raddr, err
+}
+
+func (c *connPacketConn) WriteTo(p []byte, _ net.Addr) (int, error) {
+	return c.Write(p)
+}
@@ -0,0 +1,115 @@
+package rdns
+
+import (
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DNSClient is a plain DNS resolver for UDP or TCP.
+type DNSClient struct {
+	id       string
+	endpoint string
+	net      string
+	opt      DNSClientOptions
+}
+
+var _ Resolver = &DNSClient{}
+
+// DNSClientOptions contain options used by the DNS resolver.
+type DNSClientOptions struct {
+	// Local IP to use for the connection to the upstream resolver.
+	LocalAddr net.IP
+
+	// Dialer used to establish the upstream connection. If nil, a plain
+	// *net.Dialer is used. Set this to a proxy client (e.g. *socks5.Client)
+	// to tunnel queries through a SOCKS5 proxy.
+	Dialer Dialer
+
+	// UDP only, sets the EDNS0 UDP size used in queries.
+	UDPSize uint16
+
+	QueryTimeout time.Duration
+
+	// DisableTCPFallback disables the automatic retry over TCP of queries sent
+	// over UDP that came back with the truncated (TC) flag set. Enabled by
+	// default as per RFC 5966.
+	DisableTCPFallback bool
+}
+
+// NewDNSClient returns a new instance of DNSClient which sends queries to a
+// resolver over UDP or TCP.
+func NewDNSClient(id, endpoint, net string, opt DNSClientOptions) (*DNSClient, error) {
+	return &DNSClient{
+		id:       id,
+		endpoint: endpoint,
+		net:      net,
+		opt:      opt,
+	}, nil
+}
+
+// Resolve a DNS query, forwarding it to the upstream resolver. Queries sent
+// over UDP that come back truncated are transparently retried over TCP
+// against the same upstream, reusing QueryTimeout and the configured
+// LocalAddr/Dialer (including SOCKS5) and preserving the original query ID
+// and EDNS0 options, unless DisableTCPFallback is set.
+func (d *DNSClient) Resolve(q *dns.Msg, ci ClientInfo) (*dns.Msg, error) {
+	log := logger(d.id, q, ci)
+	a, err := d.exchange(d.net, q)
+	if err != nil {
+		return a, err
+	}
+	if d.net == "udp" && a != nil && a.Truncated && !d.opt.DisableTCPFallback {
+		log.Debug("response was truncated, retrying over tcp")
+		if ta, tErr := d.exchange("tcp", q); tErr == nil {
+			a = ta
+		}
+	}
+	return a, nil
+}
+
+// exchange dials the upstream over the given network (sharing LocalAddr,
+// Dialer and QueryTimeout) and performs a single query/response exchange.
+func (d *DNSClient) exchange(network string, q *dns.Msg) (*dns.Msg, error) {
+	conn, err := d.dial(network)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if d.opt.QueryTimeout > 0 {
+		conn.SetDeadline(time.Now().Add(d.opt.QueryTimeout))
+	}
+	dc := &dns.Conn{Conn: conn, UDPSize: d.opt.UDPSize}
+	if err := dc.WriteMsg(q); err != nil {
+		return nil, err
+	}
+	return dc.ReadMsg()
+}
+
+// dial establishes the upstream connection, using the configured Dialer
+// (e.g. a SOCKS5 client) if set, falling back to a plain *net.Dialer bound
+// to LocalAddr otherwise.
+func (d *DNSClient) dial(network string) (net.Conn, error) {
+	if d.opt.Dialer != nil {
+		return d.opt.Dialer.Dial(network, d.endpoint)
+	}
+	nd := &net.Dialer{Timeout: d.opt.QueryTimeout, LocalAddr: localAddr(network, d.opt.LocalAddr)}
+	return nd.Dial(network, d.endpoint)
+}
+
+func (d *DNSClient) String() string {
+	return d.id
+}
+
+// localAddr builds a net.Addr suitable for net.Dialer.LocalAddr from an IP
+// and network, or returns nil if no IP was given.
+func localAddr(network string, ip net.IP) net.Addr {
+	if ip == nil {
+		return nil
+	}
+	if network == "tcp" {
+		return &net.TCPAddr{IP: ip}
+	}
+	return &net.UDPAddr{IP: ip}
+}
@@ -0,0 +1,16 @@
+package rdns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalAddr(t *testing.T) {
+	require.Nil(t, localAddr("udp", nil))
+
+	ip := net.ParseIP("127.0.0.1")
+	require.Equal(t, &net.TCPAddr{IP: ip}, localAddr("tcp", ip))
+	require.Equal(t, &net.UDPAddr{IP: ip}, localAddr("udp", ip))
+}
@@ -0,0 +1,126 @@
+package rdns
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DoHClient is a resolver using DNS-over-HTTPS.
+type DoHClient struct {
+	id       string
+	endpoint string
+	client   *http.Client
+	opt      DoHClientOptions
+}
+
+var _ Resolver = &DoHClient{}
+
+// DoHClientOptions contain options used by the DoH resolver.
+type DoHClientOptions struct {
+	// Method to use for queries, "GET" or "POST" (default).
+	Method string
+
+	TLSConfig *tls.Config
+
+	// BootstrapAddr overrides the IP that's dialed for endpoint, skipping
+	// a DNS lookup of the hostname in the DoH URL.
+	BootstrapAddr string
+
+	// Transport selects the HTTP transport, "" for HTTP/1.1 and HTTP/2.
+	// HTTP/3 is not implemented: "quic" makes NewDoHClient return an error.
+	Transport string
+
+	// Local IP to use for the connection to the upstream resolver.
+	LocalAddr net.IP
+
+	QueryTimeout time.Duration
+
+	// Dialer used to establish the upstream TCP connection, e.g. a SOCKS5
+	// proxy client. Not supported in combination with Transport "quic"
+	// since that requires a UDP packet connection.
+	Dialer Dialer
+}
+
+// NewDoHClient returns a new instance of DoHClient which sends queries over
+// HTTPS following RFC 8484.
+func NewDoHClient(id, endpoint string, opt DoHClientOptions) (*DoHClient, error) {
+	if opt.Method == "" {
+		opt.Method = http.MethodPost
+	}
+	if opt.Transport == "quic" {
+		if opt.Dialer != nil {
+			return nil, errors.New("doh: a SOCKS5 dialer can't be used with the quic (HTTP/3) transport, which needs a UDP-associate; use the default transport instead")
+		}
+		return nil, errors.New("doh: quic (HTTP/3) transport is not implemented")
+	}
+
+	dialContext := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if opt.BootstrapAddr != "" {
+			if _, port, err := net.SplitHostPort(addr); err == nil {
+				addr = net.JoinHostPort(opt.BootstrapAddr, port)
+			}
+		}
+		if opt.Dialer != nil {
+			return opt.Dialer.Dial(network, addr)
+		}
+		d := net.Dialer{Timeout: opt.QueryTimeout, LocalAddr: localAddr(network, opt.LocalAddr)}
+		return d.DialContext(ctx, network, addr)
+	}
+	transport := &http.Transport{
+		TLSClientConfig: opt.TLSConfig,
+		DialContext:     dialContext,
+	}
+	return &DoHClient{
+		id:       id,
+		endpoint: endpoint,
+		client:   &http.Client{Transport: transport, Timeout: opt.QueryTimeout},
+		opt:      opt,
+	}, nil
+}
+
+// Resolve a DNS query by sending it to the DoH endpoint over HTTPS.
+func (d *DoHClient) Resolve(q *dns.Msg, ci ClientInfo) (*dns.Msg, error) {
+	wire, err := q.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(d.opt.Method, d.endpoint, bytes.NewReader(wire))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("doh: unexpected status code %d from %s", resp.StatusCode, d.endpoint)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	a := new(dns.Msg)
+	if err := a.Unpack(body); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (d *DoHClient) String() string {
+	return d.id
+}
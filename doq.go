@@ -0,0 +1,105 @@
+package rdns
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+// DoQClient is a resolver using DNS-over-QUIC (RFC 9250).
+type DoQClient struct {
+	id        string
+	endpoint  string
+	transport *quic.Transport
+	raddr     net.Addr
+	opt       DoQClientOptions
+}
+
+var _ Resolver = &DoQClient{}
+
+// DoQClientOptions contain options used by the DoQ resolver.
+type DoQClientOptions struct {
+	BootstrapAddr string
+	LocalAddr     net.IP
+	TLSConfig     *tls.Config
+	QueryTimeout  time.Duration
+
+	// Dialer, if set, is used to establish the underlying UDP-associate
+	// session through a SOCKS5 proxy. Returns an error at construction if
+	// the proxy doesn't support UDP-associate.
+	Dialer Dialer
+}
+
+// NewDoQClient returns a new instance of DoQClient.
+func NewDoQClient(id, endpoint string, opt DoQClientOptions) (*DoQClient, error) {
+	dialAddr := endpoint
+	if opt.BootstrapAddr != "" {
+		if _, port, err := net.SplitHostPort(endpoint); err == nil {
+			dialAddr = net.JoinHostPort(opt.BootstrapAddr, port)
+		}
+	}
+	pc, raddr, err := dialUDPPacketConn(opt.Dialer, opt.LocalAddr, dialAddr)
+	if err != nil {
+		return nil, err
+	}
+	return &DoQClient{
+		id:        id,
+		endpoint:  endpoint,
+		transport: &quic.Transport{Conn: pc},
+		raddr:     raddr,
+		opt:       opt,
+	}, nil
+}
+
+// Resolve a DNS query over a QUIC stream, as per RFC 9250.
+func (d *DoQClient) Resolve(q *dns.Msg, ci ClientInfo) (*dns.Msg, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d.opt.QueryTimeout)
+	defer cancel()
+
+	conn, err := d.transport.Dial(ctx, d.raddr, d.opt.TLSConfig, &quic.Config{})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.CloseWithError(0, "")
+
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	wire, err := q.Pack()
+	if err != nil {
+		return nil, err
+	}
+	// RFC 9250 requires a 2-byte length prefix on DoQ streams.
+	length := []byte{byte(len(wire) >> 8), byte(len(wire))}
+	if _, err := stream.Write(append(length, wire...)); err != nil {
+		return nil, err
+	}
+	stream.Close()
+
+	lengthPrefix := make([]byte, 2)
+	if _, err := io.ReadFull(stream, lengthPrefix); err != nil {
+		return nil, err
+	}
+	respLen := int(lengthPrefix[0])<<8 | int(lengthPrefix[1])
+	resp := make([]byte, respLen)
+	if _, err := io.ReadFull(stream, resp); err != nil {
+		return nil, err
+	}
+	a := new(dns.Msg)
+	if err := a.Unpack(resp); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (d *DoQClient) String() string {
+	return d.id
+}
@@ -0,0 +1,78 @@
+package rdns
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/pion/dtls/v2"
+)
+
+// DTLSClient is a resolver using DNS-over-DTLS.
+type DTLSClient struct {
+	id       string
+	endpoint string
+	pconn    net.PacketConn
+	raddr    net.Addr
+	opt      DTLSClientOptions
+}
+
+var _ Resolver = &DTLSClient{}
+
+// DTLSClientOptions contain options used by the DTLS resolver.
+type DTLSClientOptions struct {
+	BootstrapAddr string
+	LocalAddr     net.IP
+	DTLSConfig    *dtls.Config
+	UDPSize       uint16
+	QueryTimeout  time.Duration
+
+	// Dialer, if set, is used to establish the underlying UDP-associate
+	// session through a SOCKS5 proxy. Returns an error at construction if
+	// the proxy doesn't support UDP-associate.
+	Dialer Dialer
+}
+
+// NewDTLSClient returns a new instance of DTLSClient.
+func NewDTLSClient(id, endpoint string, opt DTLSClientOptions) (*DTLSClient, error) {
+	dialAddr := endpoint
+	if opt.BootstrapAddr != "" {
+		if _, port, err := net.SplitHostPort(endpoint); err == nil {
+			dialAddr = net.JoinHostPort(opt.BootstrapAddr, port)
+		}
+	}
+	pc, raddr, err := dialUDPPacketConn(opt.Dialer, opt.LocalAddr, dialAddr)
+	if err != nil {
+		return nil, err
+	}
+	return &DTLSClient{
+		id:       id,
+		endpoint: endpoint,
+		pconn:    pc,
+		raddr:    raddr,
+		opt:      opt,
+	}, nil
+}
+
+// Resolve a DNS query over a DTLS session.
+func (d *DTLSClient) Resolve(q *dns.Msg, ci ClientInfo) (*dns.Msg, error) {
+	conn, err := dtls.ClientWithContext(context.Background(), d.pconn, d.raddr, d.opt.DTLSConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if d.opt.QueryTimeout > 0 {
+		conn.SetDeadline(time.Now().Add(d.opt.QueryTimeout))
+	}
+
+	dc := &dns.Conn{Conn: conn, UDPSize: d.opt.UDPSize}
+	if err := dc.WriteMsg(q); err != nil {
+		return nil, err
+	}
+	return dc.ReadMsg()
+}
+
+func (d *DTLSClient) String() string {
+	return d.id
+}
@@ -2,39 +2,70 @@ package rdns
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
+	"fmt"
 	"net"
 	"strconv"
+	"strings"
+	"text/template"
 	"time"
 
 	"github.com/miekg/dns"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// FastestTCPProbeMode selects how FastestTCP determines which of the
+// response IPs is reachable the fastest.
+type FastestTCPProbeMode string
+
+const (
+	// FastestTCPProbeTCP opens a TCP connection to Port. This is the default.
+	FastestTCPProbeTCP FastestTCPProbeMode = "tcp"
+
+	// FastestTCPProbeICMP sends an ICMP echo request.
+	FastestTCPProbeICMP FastestTCPProbeMode = "icmp"
+
+	// FastestTCPProbeTLS performs a full TLS handshake against Port, which
+	// also confirms the destination serves the expected certificate rather
+	// than just accepting TCP connections.
+	FastestTCPProbeTLS FastestTCPProbeMode = "tls"
 )
 
 // FastestTCP first resolves the query with the upstream resolver, then
-// performs TCP connection tests with the response IPs to determine which
-// IP responds the fastest. This IP is then returned in the response.
-// This should be used in combination with a Cache to avoid the TCP
-// connection overhead on every query.
+// probes the response IPs to determine which one responds the fastest.
+// This IP is then returned in the response. This should be used in
+// combination with a Cache to avoid the probe overhead on every query.
 type FastestTCP struct {
-	id       string
-	resolver Resolver
-	opt      FastestTCPOptions
-	port     string
+	id           string
+	resolver     Resolver
+	opt          FastestTCPOptions
+	port         string
+	serverNameTp *template.Template
 }
 
 var _ Resolver = &FastestTCP{}
 
 // FastestTCPOptions contain settings for a resolver that filters responses
-// based on TCP connection probes.
+// based on connection probes.
 type FastestTCPOptions struct {
-	// Port number to use for TCP probes, default 443
+	// Port number to use for probes, default 443
 	Port int
 
 	// Wait for all connection probes and sort the responses based on time
 	// (fastest first). This is generally slower than just waiting for the
 	// fastest, since the response time is determined by the slowest probe.
 	WaitAll bool
+
+	// Probe mode to use, one of "tcp" (default), "icmp" or "tls".
+	Mode FastestTCPProbeMode
+
+	// ServerName template used for the TLS handshake probe, e.g. "{{.Name}}".
+	// Only used when Mode is "tls". Defaults to the query name.
+	ServerName string
 }
 
 // NewFastestTCP returns a new instance of a TCP probe resolver.
@@ -43,12 +74,21 @@ func NewFastestTCP(id string, resolver Resolver, opt FastestTCPOptions) *Fastest
 	if port == "0" {
 		port = "443"
 	}
-	return &FastestTCP{
+	if opt.Mode == "" {
+		opt.Mode = FastestTCPProbeTCP
+	}
+	f := &FastestTCP{
 		id:       id,
 		resolver: resolver,
 		opt:      opt,
 		port:     port,
 	}
+	if opt.Mode == FastestTCPProbeTLS && opt.ServerName != "" {
+		if tp, err := template.New("server-name").Parse(opt.ServerName); err == nil {
+			f.serverNameTp = tp
+		}
+	}
+	return f
 }
 
 // Resolve a DNS query using a random resolver.
@@ -65,11 +105,18 @@ func (r *FastestTCP) Resolve(q *dns.Msg, ci ClientInfo) (*dns.Msg, error) {
 		return a, nil
 	}
 
-	// Extract the IP responses
+	// Extract the IP responses (both A and AAAA are probed together so the
+	// overall fastest wins regardless of address family), skipping
+	// unspecified/loopback/link-local addresses which are common in
+	// poisoned or misconfigured answers and would otherwise either succeed
+	// trivially or block the whole selection.
 	var ipRRs []dns.RR
 	for _, rr := range a.Answer {
-		if rr.Header().Rrtype == question.Qtype {
-			ipRRs = append(ipRRs, rr)
+		switch rr.Header().Rrtype {
+		case dns.TypeA, dns.TypeAAAA:
+			if probeableRR(rr) {
+				ipRRs = append(ipRRs, rr)
+			}
 		}
 	}
 
@@ -78,21 +125,21 @@ func (r *FastestTCP) Resolve(q *dns.Msg, ci ClientInfo) (*dns.Msg, error) {
 		return a, nil
 	}
 
-	// Send TCP probes to all, if anything returns an error, just return
+	// Send probes to all, if anything returns an error, just return
 	// the original response rather than trying to be clever and pick one.
-	log = log.WithField("port", r.port)
+	log = log.WithField("port", r.port).WithField("mode", string(r.opt.Mode))
 	if r.opt.WaitAll {
-		rrs, err := r.probeAll(log, ipRRs)
+		rrs, err := r.probeAll(log, q, ipRRs)
 		if err != nil {
-			log.WithError(err).Debug("tcp probe failed")
+			log.WithError(err).Debug("probe failed")
 			return a, nil
 		}
 		a.Answer = rrs
 		return a, nil
 	} else {
-		first, err := r.probeFastest(log, ipRRs)
+		first, err := r.probeFastest(log, q, ipRRs)
 		if err != nil {
-			log.WithError(err).Debug("tcp probe failed")
+			log.WithError(err).Debug("probe failed")
 			return a, nil
 		}
 		a.Answer = []dns.RR{first}
@@ -104,13 +151,28 @@ func (r *FastestTCP) String() string {
 	return r.id
 }
 
+// probeableRR returns false for RRs holding an unspecified, loopback, or
+// link-local address, which aren't useful probe targets.
+func probeableRR(rr dns.RR) bool {
+	var ip net.IP
+	switch record := rr.(type) {
+	case *dns.A:
+		ip = record.A
+	case *dns.AAAA:
+		ip = record.AAAA
+	default:
+		return false
+	}
+	return !ip.IsUnspecified() && !ip.IsLoopback() && !ip.IsLinkLocalUnicast()
+}
+
 // Probes all IPs and returns only the RR with the fastest responding IP.
 // Waits for the first one that comes back. Returns an error if the fastest response
 // is an error.
-func (r *FastestTCP) probeFastest(log logrus.FieldLogger, rrs []dns.RR) (dns.RR, error) {
+func (r *FastestTCP) probeFastest(log logrus.FieldLogger, q *dns.Msg, rrs []dns.RR) (dns.RR, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
-	resultCh := r.probe(ctx, log, rrs)
+	resultCh := r.probe(ctx, log, q, rrs)
 	select {
 	case res := <-resultCh:
 		return res.rr, res.err
@@ -121,10 +183,10 @@ func (r *FastestTCP) probeFastest(log logrus.FieldLogger, rrs []dns.RR) (dns.RR,
 
 // Probes all IPs and returns them in the order of response time, fastest first. Returns
 // an error if any of the probes fail or if the probe times out.
-func (r *FastestTCP) probeAll(log logrus.FieldLogger, rrs []dns.RR) ([]dns.RR, error) {
+func (r *FastestTCP) probeAll(log logrus.FieldLogger, q *dns.Msg, rrs []dns.RR) ([]dns.RR, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
-	resultCh := r.probe(ctx, log, rrs)
+	resultCh := r.probe(ctx, log, q, rrs)
 	results := make([]dns.RR, 0, len(rrs))
 	for i := 0; i < len(rrs); i++ {
 		select {
@@ -146,32 +208,162 @@ type tcpProbeResult struct {
 }
 
 // Probes all IPs and returns a channel with responses in the order they succeed or fail.
-func (r *FastestTCP) probe(ctx context.Context, log logrus.FieldLogger, rrs []dns.RR) <-chan tcpProbeResult {
+func (r *FastestTCP) probe(ctx context.Context, log logrus.FieldLogger, q *dns.Msg, rrs []dns.RR) <-chan tcpProbeResult {
 	resultCh := make(chan tcpProbeResult)
 	for _, rr := range rrs {
-		var d net.Dialer
 		go func(rr dns.RR) {
-			var network, ip string
-			switch record := rr.(type) {
-			case *dns.A:
-				network, ip = "tcp4", record.A.String()
-			case *dns.AAAA:
-				network, ip = "tcp6", record.AAAA.String()
-			default:
-				resultCh <- tcpProbeResult{err: errors.New("unexpected resource type")}
+			ip, err := rrIP(rr)
+			if err != nil {
+				resultCh <- tcpProbeResult{err: err}
 				return
 			}
 			start := time.Now()
-			log.WithField("ip", ip).Debug("sending tcp probe")
-			c, err := d.DialContext(ctx, network, net.JoinHostPort(ip, r.port))
+			log.WithField("ip", ip.String()).Debug("sending probe")
+			switch r.opt.Mode {
+			case FastestTCPProbeICMP:
+				err = probeICMP(ctx, ip)
+			case FastestTCPProbeTLS:
+				err = r.probeTLS(ctx, q, ip)
+			default:
+				err = r.probeTCP(ctx, ip)
+			}
 			if err != nil {
 				resultCh <- tcpProbeResult{err: err}
 				return
 			}
-			log.WithField("ip", ip).WithField("response-time", time.Since(start)).Debug("tcp probe finished")
-			defer c.Close()
+			log.WithField("ip", ip.String()).WithField("response-time", time.Since(start)).Debug("probe finished")
 			resultCh <- tcpProbeResult{rr: rr}
 		}(rr)
 	}
 	return resultCh
 }
+
+func rrIP(rr dns.RR) (net.IP, error) {
+	switch record := rr.(type) {
+	case *dns.A:
+		return record.A, nil
+	case *dns.AAAA:
+		return record.AAAA, nil
+	default:
+		return nil, errors.New("unexpected resource type")
+	}
+}
+
+func (r *FastestTCP) probeTCP(ctx context.Context, ip net.IP) error {
+	var d net.Dialer
+	c, err := d.DialContext(ctx, dialNetwork(ip), net.JoinHostPort(ip.String(), r.port))
+	if err != nil {
+		return err
+	}
+	return c.Close()
+}
+
+func (r *FastestTCP) probeTLS(ctx context.Context, q *dns.Msg, ip net.IP) error {
+	serverName := q.Question[0].Name
+	if r.serverNameTp != nil {
+		var sb strings.Builder
+		if err := r.serverNameTp.Execute(&sb, q.Question[0]); err == nil {
+			serverName = sb.String()
+		}
+	}
+	serverName = strings.TrimSuffix(serverName, ".")
+
+	var d tls.Dialer
+	d.Config = &tls.Config{ServerName: serverName}
+	c, err := d.DialContext(ctx, dialNetwork(ip), net.JoinHostPort(ip.String(), r.port))
+	if err != nil {
+		return err
+	}
+	return c.Close()
+}
+
+// probeICMP sends a single ICMP (or ICMPv6) echo request to ip and waits for
+// the reply. It first tries an unprivileged UDP socket (requires the
+// net.ipv4.ping_group_range sysctl on Linux, or an OS that allows it by
+// default), then falls back to a raw IP socket, which needs CAP_NET_RAW /
+// root.
+func probeICMP(ctx context.Context, ip net.IP) error {
+	const protoICMP, protoICMPv6 = 1, 58
+	udpNetwork, rawNetwork, proto, typ := "udp4", "ip4:icmp", protoICMP, icmp.Type(ipv4.ICMPTypeEcho)
+	if ip.To4() == nil {
+		udpNetwork, rawNetwork, proto, typ = "udp6", "ip6:ipv6-icmp", protoICMPv6, icmp.Type(ipv6.ICMPTypeEchoRequest)
+	}
+
+	var dst net.Addr = &net.UDPAddr{IP: ip}
+	conn, err := icmp.ListenPacket(udpNetwork, "")
+	if err != nil {
+		dst = &net.IPAddr{IP: ip}
+		conn, err = icmp.ListenPacket(rawNetwork, "")
+		if err != nil {
+			return fmt.Errorf("icmp probe requires either the ping_group_range sysctl or raw socket (CAP_NET_RAW) privileges: %w", err)
+		}
+	}
+	defer conn.Close()
+
+	id, seq := int(time.Now().UnixNano()&0xffff), 1
+	msg := icmp.Message{
+		Type: typ, Code: 0,
+		Body: &icmp.Echo{ID: id, Seq: seq, Data: []byte("routedns")},
+	}
+	b, err := msg.Marshal(nil)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.WriteTo(b, dst); err != nil {
+		return err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetReadDeadline(deadline)
+	}
+	reply := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(reply)
+		if err != nil {
+			return err
+		}
+		// The raw-socket fallback listens for every ICMP packet of this
+		// protocol arriving at the host, not just replies to this probe -
+		// and probe() runs one of these per candidate IP concurrently - so
+		// the peer address and the echo's ID/Seq must both be checked
+		// before a reply is accepted, or a probe can be satisfied by a
+		// reply meant for a different goroutine (or unrelated traffic
+		// entirely) and report an unreachable IP as fastest.
+		if !peerIP(peer).Equal(ip) {
+			continue
+		}
+		rm, err := icmp.ParseMessage(proto, reply[:n])
+		if err != nil {
+			continue
+		}
+		if rm.Type != ipv4.ICMPTypeEchoReply && rm.Type != ipv6.ICMPTypeEchoReply {
+			continue
+		}
+		echo, ok := rm.Body.(*icmp.Echo)
+		if !ok || echo.ID != id || echo.Seq != seq {
+			continue
+		}
+		return nil
+	}
+}
+
+// peerIP extracts the IP address out of the net.Addr returned by
+// icmp.PacketConn.ReadFrom, which is a *net.UDPAddr on the unprivileged ping
+// socket and a *net.IPAddr on the raw socket fallback.
+func peerIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP
+	case *net.IPAddr:
+		return a.IP
+	default:
+		return nil
+	}
+}
+
+func dialNetwork(ip net.IP) string {
+	if ip.To4() != nil {
+		return "tcp4"
+	}
+	return "tcp6"
+}
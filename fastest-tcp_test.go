@@ -0,0 +1,50 @@
+package rdns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbeableRR(t *testing.T) {
+	tests := []struct {
+		name string
+		rr   dns.RR
+		want bool
+	}{
+		{"public v4", &dns.A{A: mustParseIP("93.184.216.34")}, true},
+		{"unspecified v4", &dns.A{A: mustParseIP("0.0.0.0")}, false},
+		{"loopback v4", &dns.A{A: mustParseIP("127.0.0.1")}, false},
+		{"link-local v4", &dns.A{A: mustParseIP("169.254.1.1")}, false},
+		{"public v6", &dns.AAAA{AAAA: mustParseIP("2606:2800:220:1:248:1893:25c8:1946")}, true},
+		{"unspecified v6", &dns.AAAA{AAAA: mustParseIP("::")}, false},
+		{"loopback v6", &dns.AAAA{AAAA: mustParseIP("::1")}, false},
+		{"link-local v6", &dns.AAAA{AAAA: mustParseIP("fe80::1")}, false},
+		{"other record type", &dns.CNAME{Target: "example.com."}, false},
+	}
+	for _, test := range tests {
+		require.Equal(t, test.want, probeableRR(test.rr), test.name)
+	}
+}
+
+func TestDialNetwork(t *testing.T) {
+	require.Equal(t, "tcp4", dialNetwork(mustParseIP("93.184.216.34")))
+	require.Equal(t, "tcp6", dialNetwork(mustParseIP("2606:2800:220:1:248:1893:25c8:1946")))
+}
+
+func TestPeerIP(t *testing.T) {
+	ip := mustParseIP("93.184.216.34")
+	require.True(t, ip.Equal(peerIP(&net.UDPAddr{IP: ip})), "unprivileged ping socket returns a *net.UDPAddr")
+	require.True(t, ip.Equal(peerIP(&net.IPAddr{IP: ip})), "raw socket fallback returns a *net.IPAddr")
+	require.Nil(t, peerIP(&net.TCPAddr{IP: ip}), "unexpected address types should not be mistaken for a match")
+}
+
+func mustParseIP(s string) net.IP {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		panic("invalid test IP: " + s)
+	}
+	return ip
+}
@@ -0,0 +1,133 @@
+package rdns
+
+import (
+	"sort"
+
+	"github.com/miekg/dns"
+)
+
+// ParallelBest sends queries to all upstream resolvers concurrently and
+// returns the first non-error, non-SERVFAIL response. Unlike the
+// failover/random groups (which try upstreams sequentially), this is a live
+// race intended to minimize tail latency across geographically diverse
+// resolvers. The Resolver interface has no cancellation hook, so the
+// outstanding queries to the upstreams that didn't win the race are not
+// cancelled - they're simply abandoned and their (buffered) results
+// discarded once they arrive.
+type ParallelBest struct {
+	id        string
+	resolvers []Resolver
+	weights   []int
+	opt       ParallelBestOptions
+}
+
+var _ Resolver = &ParallelBest{}
+
+// ParallelBestOptions contain settings for the ParallelBest resolver group.
+type ParallelBestOptions struct {
+	// Relative weight of each resolver, same length/order as the resolvers
+	// passed to NewParallelBest. A weight of 0 is treated as 1. With the
+	// default MinResponses of 1, the first usable answer wins and weight has
+	// no effect. With MinResponses > 1, the highest-weighted answer among
+	// the MinResponses collected is returned - not necessarily the fastest
+	// of those - so a trusted-but-slower upstream can still be preferred
+	// over a faster, less trusted one.
+	Weights []int
+
+	// Wait for this many usable (non-error, non-SERVFAIL) answers, or until
+	// every upstream has returned, before picking the best of those received
+	// so far, rather than returning on the very first success. Errors and
+	// SERVFAILs don't count toward it. Helps filter a poisoned answer from
+	// one upstream. Default 1.
+	MinResponses int
+}
+
+// NewParallelBest returns a new instance of a ParallelBest resolver group.
+func NewParallelBest(id string, resolvers []Resolver, opt ParallelBestOptions) *ParallelBest {
+	weights := opt.Weights
+	if len(weights) != len(resolvers) {
+		weights = make([]int, len(resolvers))
+	}
+	for i, w := range weights {
+		if w <= 0 {
+			weights[i] = 1
+		}
+	}
+	if opt.MinResponses < 1 {
+		opt.MinResponses = 1
+	}
+	return &ParallelBest{
+		id:        id,
+		resolvers: resolvers,
+		weights:   weights,
+		opt:       opt,
+	}
+}
+
+type parallelBestResult struct {
+	index int
+	a     *dns.Msg
+	err   error
+}
+
+// Resolve sends the query to every upstream concurrently and returns the
+// best of the first MinResponses usable answers to come back (or of all
+// usable answers, if fewer than that arrive). Upstreams that are still
+// outstanding once that happens are left to run to completion in the
+// background; their results are discarded into the (buffered) result
+// channel so none of the goroutines leak.
+func (r *ParallelBest) Resolve(q *dns.Msg, ci ClientInfo) (*dns.Msg, error) {
+	resultCh := make(chan parallelBestResult, len(r.resolvers))
+	for i, resolver := range r.resolvers {
+		go func(i int, resolver Resolver) {
+			a, err := resolver.Resolve(q, ci)
+			resultCh <- parallelBestResult{index: i, a: a, err: err}
+		}(i, resolver)
+	}
+
+	var (
+		received     []parallelBestResult
+		lastErr      error
+		lastRejected *dns.Msg
+	)
+	for i := 0; i < len(r.resolvers); i++ {
+		res := <-resultCh
+		if res.err != nil {
+			lastErr = res.err
+			continue
+		}
+		if !isUsableAnswer(res.a) {
+			lastRejected = res.a
+			continue
+		}
+		received = append(received, res)
+		if len(received) >= r.opt.MinResponses {
+			break
+		}
+	}
+	if len(received) == 0 {
+		// Nothing usable came back. Prefer surfacing a real answer (even a
+		// SERVFAIL) over a bare error, the way the failover group does,
+		// since a caller writing the response to the wire needs either a
+		// non-nil message or a non-nil error, never neither.
+		if lastRejected != nil {
+			return lastRejected, nil
+		}
+		return nil, lastErr
+	}
+
+	sort.SliceStable(received, func(i, j int) bool {
+		return r.weights[received[i].index] > r.weights[received[j].index]
+	})
+	return received[0].a, nil
+}
+
+// isUsableAnswer returns false for nil or SERVFAIL responses, which
+// shouldn't win the race against a real answer from another upstream.
+func isUsableAnswer(a *dns.Msg) bool {
+	return a != nil && a.Rcode != dns.RcodeServerFailure
+}
+
+func (r *ParallelBest) String() string {
+	return r.id
+}
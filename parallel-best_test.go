@@ -0,0 +1,120 @@
+package rdns
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewParallelBestDefaults(t *testing.T) {
+	pb := NewParallelBest("test", []Resolver{stubResolver{}, stubResolver{}}, ParallelBestOptions{})
+	require.Equal(t, []int{1, 1}, pb.weights)
+	require.Equal(t, 1, pb.opt.MinResponses)
+
+	pb = NewParallelBest("test", []Resolver{stubResolver{}, stubResolver{}}, ParallelBestOptions{Weights: []int{0, 5}})
+	require.Equal(t, []int{1, 5}, pb.weights)
+}
+
+func TestIsUsableAnswer(t *testing.T) {
+	require.False(t, isUsableAnswer(nil))
+
+	servfail := new(dns.Msg)
+	servfail.Rcode = dns.RcodeServerFailure
+	require.False(t, isUsableAnswer(servfail))
+
+	ok := new(dns.Msg)
+	ok.Rcode = dns.RcodeSuccess
+	require.True(t, isUsableAnswer(ok))
+}
+
+type stubResolver struct{}
+
+func (stubResolver) Resolve(q *dns.Msg, ci ClientInfo) (*dns.Msg, error) { return nil, nil }
+func (stubResolver) String() string                                     { return "stub" }
+
+// funcResolver calls fn to produce a canned answer/error, for tests that need
+// to control exactly what each upstream in the race returns.
+type funcResolver struct {
+	fn func(q *dns.Msg) (*dns.Msg, error)
+}
+
+func (r funcResolver) Resolve(q *dns.Msg, ci ClientInfo) (*dns.Msg, error) { return r.fn(q) }
+func (funcResolver) String() string                                       { return "func" }
+
+func TestParallelBestResolveReturnsFirstUsable(t *testing.T) {
+	q := new(dns.Msg)
+	q.SetQuestion("example.com.", dns.TypeA)
+
+	ok := new(dns.Msg)
+	ok.SetRcode(q, dns.RcodeSuccess)
+
+	pb := NewParallelBest("test", []Resolver{
+		funcResolver{func(q *dns.Msg) (*dns.Msg, error) { return nil, errors.New("boom") }},
+		funcResolver{func(q *dns.Msg) (*dns.Msg, error) { return ok, nil }},
+	}, ParallelBestOptions{})
+
+	a, err := pb.Resolve(q, ClientInfo{})
+	require.NoError(t, err)
+	require.Equal(t, ok, a)
+}
+
+func TestParallelBestResolveAllErrors(t *testing.T) {
+	q := new(dns.Msg)
+	q.SetQuestion("example.com.", dns.TypeA)
+	boom := errors.New("boom")
+
+	pb := NewParallelBest("test", []Resolver{
+		funcResolver{func(q *dns.Msg) (*dns.Msg, error) { return nil, boom }},
+		funcResolver{func(q *dns.Msg) (*dns.Msg, error) { return nil, boom }},
+	}, ParallelBestOptions{})
+
+	a, err := pb.Resolve(q, ClientInfo{})
+	require.Nil(t, a)
+	require.Error(t, err, "must not return (nil, nil) when every upstream errored")
+}
+
+func TestParallelBestResolveFallsBackToRejectedAnswer(t *testing.T) {
+	q := new(dns.Msg)
+	q.SetQuestion("example.com.", dns.TypeA)
+
+	servfail := new(dns.Msg)
+	servfail.SetRcode(q, dns.RcodeServerFailure)
+
+	// One upstream errors, the other returns SERVFAIL - in whichever order
+	// they arrive, e.g. SERVFAIL last, where a naive "lastErr = res.err"
+	// would clobber the real error back to nil and the caller would see
+	// (nil, nil).
+	pb := NewParallelBest("test", []Resolver{
+		funcResolver{func(q *dns.Msg) (*dns.Msg, error) { return nil, errors.New("boom") }},
+		funcResolver{func(q *dns.Msg) (*dns.Msg, error) { return servfail, nil }},
+	}, ParallelBestOptions{MinResponses: 2})
+
+	a, err := pb.Resolve(q, ClientInfo{})
+	require.NoError(t, err)
+	require.Equal(t, servfail, a, "should fall back to the rejected SERVFAIL answer rather than returning nothing")
+}
+
+func TestParallelBestResolveWeightPrefersHighestAmongCollected(t *testing.T) {
+	q := new(dns.Msg)
+	q.SetQuestion("example.com.", dns.TypeA)
+
+	first := new(dns.Msg)
+	first.SetRcode(q, dns.RcodeSuccess)
+	first.Answer = []dns.RR{&dns.A{Hdr: dns.RR_Header{Name: "first."}}}
+
+	second := new(dns.Msg)
+	second.SetRcode(q, dns.RcodeSuccess)
+	second.Answer = []dns.RR{&dns.A{Hdr: dns.RR_Header{Name: "second."}}}
+
+	pb := NewParallelBest("test", []Resolver{
+		funcResolver{func(q *dns.Msg) (*dns.Msg, error) { return first, nil }},
+		funcResolver{func(q *dns.Msg) (*dns.Msg, error) { time.Sleep(10 * time.Millisecond); return second, nil }},
+	}, ParallelBestOptions{Weights: []int{1, 5}, MinResponses: 2})
+
+	a, err := pb.Resolve(q, ClientInfo{})
+	require.NoError(t, err)
+	require.Equal(t, second, a, "the higher-weighted answer should win among the MinResponses collected, even though it arrived second")
+}